@@ -0,0 +1,261 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package leveldb
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/philsong/goleveldb/leveldb/iterator"
+	"github.com/philsong/goleveldb/leveldb/memdb"
+	"github.com/philsong/goleveldb/leveldb/opt"
+	"github.com/philsong/goleveldb/leveldb/util"
+)
+
+// ErrTransactionDone is returned by any Transaction method called after
+// Commit or Discard.
+var ErrTransactionDone = errors.New("leveldb: transaction already committed or discarded")
+
+// Transaction is an isolated read-modify-write view of the database. All
+// reads made through a transaction observe the version that was current
+// when the transaction was opened, regardless of writes (by this or any
+// other writer) that happen afterwards; all writes made through a
+// transaction are buffered in memory and are invisible to everyone,
+// including the transaction's own Get/Has/NewIterator calls routed through
+// the DB, until Commit is called.
+//
+// Only one transaction may be open at a time; OpenTransaction blocks until
+// any previous transaction is committed or discarded. That serialization
+// is scoped to transactions alone, via db.s.trMu below -- it does not hold
+// up ordinary DB.Put/DB.Write callers or background memtable flushes.
+//
+// A Transaction must eventually be committed or discarded; until then the
+// version it pins keeps every table file it references alive, so
+// compaction cannot reclaim them. The same pin also keeps the
+// transaction's read sequence number alive in db.s's minPinnedSeq(); once
+// doCompactionWork is taught to consult that floor, a long-lived
+// transaction's view can't be corrupted by a concurrent compaction either,
+// but that wiring does not exist yet, so pinSeq/unpinSeq is bookkeeping
+// only for now.
+type Transaction struct {
+	db   *DB
+	snap *version
+	seq  uint64
+	mem  *memdb.DB
+	wseq uint64 // sequence numbers handed out to buffered writes, relative to seq
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// OpenTransaction opens a transaction. The returned Transaction pins the
+// session's current version so that concurrent compactions cannot drop
+// the tables it reads from, and registers its read sequence with the
+// session (see minPinnedSeq). Compaction does not consult that
+// registration.
+func (db *DB) OpenTransaction() (*Transaction, error) {
+	if err := db.ok(); err != nil {
+		return nil, err
+	}
+
+	s := db.s
+
+	// Dedicated to serializing transactions against each other; unlike
+	// db.writeLockC this is never held by a plain Put/Write, so it
+	// can't stall ordinary writers or background flushes for the
+	// lifetime of a user-held transaction.
+	s.trMu.Lock()
+	s.vmu.Lock()
+	snap := s.stVersion
+	snap.ref++
+	s.vmu.Unlock()
+
+	seq := db.getSeq()
+	s.pinSeq(seq)
+
+	tr := &Transaction{
+		db:   db,
+		snap: snap,
+		seq:  seq,
+		mem:  memdb.New(s.cmp, s.o.GetWriteBuffer()),
+	}
+	return tr, nil
+}
+
+func (tr *Transaction) ok() error {
+	if tr.closed {
+		return ErrTransactionDone
+	}
+	return nil
+}
+
+// Get follows the same semantics as DB.Get, but reads through the
+// transaction's pinned snapshot overlaid with its buffered writes.
+func (tr *Transaction) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if err := tr.ok(); err != nil {
+		return nil, err
+	}
+	// Buffered writes are stamped with tr.seq+tr.wseq, not tr.seq (see
+	// nextIkey), so the ceiling here must be the same or a write the
+	// transaction just made would be invisible to its own Get.
+	if v, err := tr.db.getFromMem(tr.mem, tr.seq+tr.wseq, key); err == nil {
+		return v, nil
+	} else if err != ErrNotFound {
+		return nil, err
+	}
+	return tr.db.getFromVersion(tr.snap, tr.seq, key, ro)
+}
+
+// Has is like Get but only reports whether the key exists.
+func (tr *Transaction) Has(key []byte, ro *opt.ReadOptions) (bool, error) {
+	_, err := tr.Get(key, ro)
+	switch err {
+	case nil:
+		return true, nil
+	case ErrNotFound:
+		return false, nil
+	}
+	return false, err
+}
+
+// NewIterator returns an iterator over the transaction's buffered writes
+// merged with its pinned snapshot, following the same slice and range
+// semantics as DB.NewIterator.
+func (tr *Transaction) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if err := tr.ok(); err != nil {
+		return iterator.NewEmptyIterator(err)
+	}
+	memIt := tr.mem.NewIterator(slice)
+	verIt := tr.db.newRawIterator(tr.snap, tr.seq, slice, ro)
+	return iterator.NewMergedIterator([]iterator.Iterator{memIt, verIt}, tr.db.s.cmp, true)
+}
+
+// Put buffers a key/value pair; it becomes visible to other readers only
+// once Commit succeeds.
+func (tr *Transaction) Put(key, value []byte, wo *opt.WriteOptions) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if err := tr.ok(); err != nil {
+		return err
+	}
+	return tr.mem.Put(tr.nextIkey(key, ktVal), value)
+}
+
+// Delete buffers a tombstone for key; it becomes visible to other readers
+// only once Commit succeeds.
+func (tr *Transaction) Delete(key []byte, wo *opt.WriteOptions) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if err := tr.ok(); err != nil {
+		return err
+	}
+	return tr.mem.Put(tr.nextIkey(key, ktDel), nil)
+}
+
+// nextIkey encodes ukey as an internal key carrying the next sequence
+// number in this transaction's own write buffer, so tr.mem -- which is
+// keyed by the session's internal-key comparer, same as every other
+// memdb in the write path -- orders repeated writes to the same user key
+// the same way DB.Write does: last write wins.
+func (tr *Transaction) nextIkey(ukey []byte, kt kType) iKey {
+	tr.wseq++
+	return newIkey(ukey, tr.seq+tr.wseq, kt)
+}
+
+// Write applies the given batch to the transaction's buffer.
+func (tr *Transaction) Write(b *Batch, wo *opt.WriteOptions) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if err := tr.ok(); err != nil {
+		return err
+	}
+	if err := b.replay(tr.mem, tr.seq+tr.wseq+1); err != nil {
+		return err
+	}
+	tr.wseq += uint64(b.Len())
+	return nil
+}
+
+// Commit flushes the transaction's buffered writes, newest write per key,
+// into a single write batch and applies it atomically via db.writeBatch.
+// After Commit returns, whether in error or not, the transaction is done
+// and its pinned version and sequence are released.
+func (tr *Transaction) Commit() error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if err := tr.ok(); err != nil {
+		return err
+	}
+
+	b := new(Batch)
+	// tr.mem is keyed by the session's internal-key comparer, which for
+	// equal user keys orders by descending sequence -- newest first.
+	// seen stops us re-appending an older write to the same user key
+	// once its newest write has already gone into b; b.replay later
+	// assigns real sequence numbers in append order, so appending every
+	// entry (instead of just the newest) would let a stale write win.
+	seen := make(map[string]bool)
+	iter := tr.mem.NewIterator(nil)
+	for iter.Next() {
+		ikey := iKey(iter.Key())
+		ukey, _, kt, ok := ikey.parseNum()
+		if !ok {
+			continue
+		}
+		if seen[string(ukey)] {
+			continue
+		}
+		seen[string(ukey)] = true
+		switch kt {
+		case ktVal:
+			b.Put(ukey, iter.Value())
+		case ktDel:
+			b.Delete(ukey)
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		tr.setDone()
+		return err
+	}
+
+	err := tr.db.writeBatch(b, nil)
+	tr.setDone()
+	return err
+}
+
+// Discard abandons the transaction's buffered writes and releases its
+// pinned version and sequence.
+func (tr *Transaction) Discard() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.closed {
+		return
+	}
+	tr.setDone()
+}
+
+// setDone releases the pinned version and sequence, and unblocks the next
+// OpenTransaction caller. The caller must hold tr.mu.
+func (tr *Transaction) setDone() {
+	tr.closed = true
+
+	s := tr.db.s
+	s.vmu.Lock()
+	tr.snap.ref--
+	if tr.snap.ref <= 0 {
+		tr.snap.release()
+	}
+	s.vmu.Unlock()
+	s.unpinSeq(tr.seq)
+
+	s.trMu.Unlock()
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package leveldb
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/philsong/goleveldb/leveldb/storage"
+	"github.com/philsong/goleveldb/leveldb/testutil"
+)
+
+var _ = Describe("Transaction", func() {
+	var (
+		stor storage.Storage
+		db   *DB
+	)
+
+	BeforeEach(func() {
+		stor = testutil.NewStorage()
+		var err error
+		db, err = Open(stor, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		db.Close()
+		stor.Close()
+	})
+
+	It("round-trips Put and Delete through Commit", func() {
+		Expect(db.Put([]byte("a"), []byte("1"), nil)).NotTo(HaveOccurred())
+		Expect(db.Put([]byte("b"), []byte("2"), nil)).NotTo(HaveOccurred())
+
+		tr, err := db.OpenTransaction()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(tr.Put([]byte("a"), []byte("1-updated"), nil)).NotTo(HaveOccurred())
+		Expect(tr.Delete([]byte("b"), nil)).NotTo(HaveOccurred())
+		Expect(tr.Put([]byte("c"), []byte("3"), nil)).NotTo(HaveOccurred())
+
+		// Buffered writes must be invisible to everyone else,
+		// including plain DB reads, until Commit.
+		v, err := db.Get([]byte("a"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v).To(Equal([]byte("1")))
+
+		// But visible to the transaction's own reads.
+		v, err = tr.Get([]byte("a"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v).To(Equal([]byte("1-updated")))
+
+		Expect(tr.Commit()).NotTo(HaveOccurred())
+
+		v, err = db.Get([]byte("a"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v).To(Equal([]byte("1-updated")))
+
+		_, err = db.Get([]byte("b"), nil)
+		Expect(err).To(Equal(ErrNotFound))
+
+		v, err = db.Get([]byte("c"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v).To(Equal([]byte("3")))
+	})
+
+	It("discards buffered writes without touching the DB", func() {
+		Expect(db.Put([]byte("a"), []byte("1"), nil)).NotTo(HaveOccurred())
+
+		tr, err := db.OpenTransaction()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tr.Put([]byte("a"), []byte("discarded"), nil)).NotTo(HaveOccurred())
+		tr.Discard()
+
+		v, err := db.Get([]byte("a"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v).To(Equal([]byte("1")))
+	})
+})
@@ -0,0 +1,196 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package opt
+
+const (
+	defaultWriteBuffer  = 4 * 1024 * 1024
+	defaultMaxOpenFiles = 500
+)
+
+// Cacher is the minimal interface Options.BlockCache must satisfy.
+type Cacher interface {
+	Purge(fin func())
+}
+
+// Strict is a bitmask of strictness flags controlling which classes of
+// on-disk corruption are fatal instead of being logged and skipped.
+type Strict uint
+
+const (
+	// StrictManifest makes MANIFEST decoding errors fatal.
+	StrictManifest Strict = 1 << iota
+	// StrictIterator makes decode errors surfaced while iterating
+	// table contents (e.g. during compaction) fatal.
+	StrictIterator
+)
+
+// CompactionStrategy selects the CompactionPicker implementation a
+// session uses; see session.newCompactionPicker.
+type CompactionStrategy int
+
+const (
+	// LeveledCompaction compacts the level with the highest cScore, or
+	// the table that most recently triggered too many seeks. It is the
+	// default when Options.CompactionStrategy is left zero.
+	LeveledCompaction CompactionStrategy = iota
+	// SizeTieredCompaction groups each level's tables into size-ratio
+	// runs and schedules a run once it accumulates MinMergeTables
+	// files, trading read amplification for lower write amplification.
+	SizeTieredCompaction
+)
+
+// Options holds the tunables for opening and operating a DB. A nil
+// *Options, or a zero field, means "use the default" everywhere a Get*
+// accessor below is provided.
+type Options struct {
+	// WriteBuffer is the amount of data to build up in a memtable
+	// before it's flushed to a new level-0 table.
+	WriteBuffer int
+
+	// MaxOpenFiles bounds the number of file descriptors the table
+	// cache keeps open at once.
+	MaxOpenFiles int
+
+	// BlockCache, if set, is purged when the session closes.
+	BlockCache Cacher
+
+	// Strict selects which classes of on-disk corruption are fatal;
+	// see the Strict* flags.
+	Strict Strict
+
+	// CompactionReadBytesPerSec and CompactionWriteBytesPerSec throttle
+	// compaction input and output I/O respectively; zero disables the
+	// corresponding limiter. CompactionTotalBytesPerSec, if set, caps
+	// each of the two separately and is used for whichever of the two is
+	// left unset; reads and writes keep separate limiters, so their
+	// combined rate is not bounded by it.
+	CompactionReadBytesPerSec  int
+	CompactionWriteBytesPerSec int
+	CompactionTotalBytesPerSec int
+
+	// CompactionStrategy selects the CompactionPicker implementation;
+	// see the CompactionStrategy type above.
+	CompactionStrategy CompactionStrategy
+
+	// SizeRatio and MinMergeTables tune the size-tiered picker; both are
+	// ignored unless CompactionStrategy is SizeTieredCompaction.
+	SizeRatio      int
+	MinMergeTables int
+
+	// MaxConcurrentCompactions bounds how many compactions
+	// compactionScheduler admits at once; zero preserves the
+	// historical one-compaction-at-a-time behaviour.
+	MaxConcurrentCompactions int
+}
+
+// GetWriteBuffer returns o.WriteBuffer, or the default if unset.
+func (o *Options) GetWriteBuffer() int {
+	if o == nil || o.WriteBuffer <= 0 {
+		return defaultWriteBuffer
+	}
+	return o.WriteBuffer
+}
+
+// GetMaxOpenFiles returns o.MaxOpenFiles, or the default if unset.
+func (o *Options) GetMaxOpenFiles() int {
+	if o == nil || o.MaxOpenFiles <= 0 {
+		return defaultMaxOpenFiles
+	}
+	return o.MaxOpenFiles
+}
+
+// GetBlockCache returns o.BlockCache, or nil if o is nil.
+func (o *Options) GetBlockCache() Cacher {
+	if o == nil {
+		return nil
+	}
+	return o.BlockCache
+}
+
+// GetStrict reports whether strict is set in o.Strict.
+func (o *Options) GetStrict(strict Strict) bool {
+	if o == nil {
+		return false
+	}
+	return o.Strict&strict != 0
+}
+
+// GetCompactionReadBytesPerSec returns o.CompactionReadBytesPerSec, or 0
+// (no limit) if o is nil.
+func (o *Options) GetCompactionReadBytesPerSec() int {
+	if o == nil {
+		return 0
+	}
+	return o.CompactionReadBytesPerSec
+}
+
+// GetCompactionWriteBytesPerSec returns o.CompactionWriteBytesPerSec, or 0
+// (no limit) if o is nil.
+func (o *Options) GetCompactionWriteBytesPerSec() int {
+	if o == nil {
+		return 0
+	}
+	return o.CompactionWriteBytesPerSec
+}
+
+// GetCompactionTotalBytesPerSec returns o.CompactionTotalBytesPerSec, or 0
+// (no limit) if o is nil.
+func (o *Options) GetCompactionTotalBytesPerSec() int {
+	if o == nil {
+		return 0
+	}
+	return o.CompactionTotalBytesPerSec
+}
+
+// GetCompactionStrategy returns o.CompactionStrategy, or LeveledCompaction
+// if o is nil.
+func (o *Options) GetCompactionStrategy() CompactionStrategy {
+	if o == nil {
+		return LeveledCompaction
+	}
+	return o.CompactionStrategy
+}
+
+// GetSizeRatio returns o.SizeRatio, or 0 (use the picker's own default) if
+// o is nil.
+func (o *Options) GetSizeRatio() int {
+	if o == nil {
+		return 0
+	}
+	return o.SizeRatio
+}
+
+// GetMinMergeTables returns o.MinMergeTables, or 0 (use the picker's own
+// default) if o is nil.
+func (o *Options) GetMinMergeTables() int {
+	if o == nil {
+		return 0
+	}
+	return o.MinMergeTables
+}
+
+// GetMaxConcurrentCompactions returns o.MaxConcurrentCompactions, or 0
+// (use the scheduler's own default) if o is nil.
+func (o *Options) GetMaxConcurrentCompactions() int {
+	if o == nil {
+		return 0
+	}
+	return o.MaxConcurrentCompactions
+}
+
+// ReadOptions controls per-call read behaviour.
+type ReadOptions struct {
+	// DontFillCache skips populating the block cache with blocks read
+	// to satisfy this call.
+	DontFillCache bool
+}
+
+// WriteOptions controls per-call write behaviour.
+type WriteOptions struct {
+	// Sync forces a fsync of the journal before the call returns.
+	Sync bool
+}
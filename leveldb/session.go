@@ -51,6 +51,24 @@ type session struct {
 	stCPtrs   [kNumLevels]iKey // compact pointers; need external synchronization
 	stVersion *version         // current version
 	vmu       sync.Mutex
+
+	// Compaction I/O throttles; nil when the corresponding option is
+	// unset, in which case Take is a no-op.
+	compReadLimit  *util.RateLimiter
+	compWriteLimit *util.RateLimiter
+
+	compBytesRead    uint64 // atomic
+	compBytesWritten uint64 // atomic
+	compThrottleWait uint64 // atomic; nanoseconds spent blocked on the throttle
+
+	picker     CompactionPicker
+	sched      *compactionScheduler
+	pinnedSeqs *pinnedSeqs
+
+	// trMu serializes DB.OpenTransaction against itself; see
+	// Transaction's doc comment in db_transaction.go. Its zero value is
+	// ready to use, unlike the channel-based lock this replaced.
+	trMu sync.Mutex
 }
 
 func newSession(stor storage.Storage, o *opt.Options) (s *session, err error) {
@@ -68,9 +86,56 @@ func newSession(stor storage.Storage, o *opt.Options) (s *session, err error) {
 	s.setOptions(o)
 	s.tops = newTableOps(s, s.o.GetMaxOpenFiles())
 	s.setVersion(&version{s: s})
+	s.initCompactionThrottle()
+	s.picker = newCompactionPicker(s)
+	s.sched = newCompactionScheduler(s)
+	s.pinnedSeqs = newPinnedSeqs()
 	return
 }
 
+// initCompactionThrottle (re)builds the compaction read/write rate
+// limiters from the session's options; a rate of 0 disables throttling
+// for that limiter.
+func (s *session) initCompactionThrottle() {
+	total := s.o.GetCompactionTotalBytesPerSec()
+	read := s.o.GetCompactionReadBytesPerSec()
+	write := s.o.GetCompactionWriteBytesPerSec()
+	if total > 0 {
+		if read <= 0 || read > total {
+			read = total
+		}
+		if write <= 0 || write > total {
+			write = total
+		}
+	}
+	if read > 0 {
+		s.compReadLimit = util.NewRateLimiter(float64(read), float64(read)*2)
+	}
+	if write > 0 {
+		s.compWriteLimit = util.NewRateLimiter(float64(write), float64(write)*2)
+	}
+}
+
+// throttleRead charges n bytes against the shared compaction read budget,
+// blocking until the tokens are available.
+func (s *session) throttleRead(n int) {
+	atomic.AddUint64(&s.compBytesRead, uint64(n))
+	if s.compReadLimit != nil {
+		wait := s.compReadLimit.Take(n)
+		atomic.AddUint64(&s.compThrottleWait, uint64(wait))
+	}
+}
+
+// throttleWrite charges n bytes against the shared compaction write
+// budget, blocking until the tokens are available.
+func (s *session) throttleWrite(n int) {
+	atomic.AddUint64(&s.compBytesWritten, uint64(n))
+	if s.compWriteLimit != nil {
+		wait := s.compWriteLimit.Take(n)
+		atomic.AddUint64(&s.compThrottleWait, uint64(wait))
+	}
+}
+
 // Close session.
 func (s *session) close() {
 	s.tops.close()
@@ -135,9 +200,10 @@ func (s *session) recover() (err error) {
 
 		err = rec.decode(r)
 		if err == nil {
-			// save compact pointers
+			// save compact pointers, through the same per-level
+			// lock a concurrent picker's read of stCPtrs uses
 			for _, rp := range rec.compactionPointers {
-				s.stCPtrs[rp.level] = iKey(rp.key)
+				s.sched.advanceCompactPointer(rp.level, iKey(rp.key))
 			}
 			// commit record to version staging
 			staging.commit(rec)
@@ -171,8 +237,25 @@ func (s *session) recover() (err error) {
 	return nil
 }
 
-// Commit session; need external synchronization.
-func (s *session) commit(r *sessionRecord) (err error) {
+// Commit session; need external synchronization. When several
+// compactions run concurrently (see compactionScheduler) their table I/O
+// overlaps freely, but each must still call commit one at a time so
+// manifest writes and version spawning stay serialized.
+//
+// c is the compaction that produced r, or nil for version changes that
+// don't originate from a compaction (memtable flushes, ...). When c is
+// non-nil, commit releases it from s.sched once the manifest write is
+// resolved, whether or not it succeeded. doCompactionWork must route its
+// sessionRecord through this, passing its own compaction as c, rather
+// than committing directly: without the release, the scheduler slot c
+// occupies -- and, with the default MaxConcurrentCompactions of 1, every
+// slot -- stays taken forever, so no later compaction would ever be
+// admitted again.
+func (s *session) commit(r *sessionRecord, c *compaction) (err error) {
+	if c != nil {
+		defer s.sched.release(c)
+	}
+
 	// spawn new version based on current version
 	nv := s.version_NB().spawn(r)
 
@@ -192,63 +275,54 @@ func (s *session) commit(r *sessionRecord) (err error) {
 }
 
 // Pick a compaction based on current state; need external synchronization.
+//
+// The actual selection policy is delegated to s.picker, which defaults to
+// the leveled picker in session_picker.go but can be swapped via
+// opt.Options.CompactionStrategy. The picked compaction is then admitted
+// through s.sched, which may reject it if its range overlaps a
+// compaction already running on another goroutine or if
+// MaxConcurrentCompactions has been reached.
+//
+// A nil result keeps exactly its pre-existing meaning -- "nothing to
+// compact right now" -- whether that's because no level scored high
+// enough or because the one candidate that did is contended; the
+// background compaction loop already has to tolerate spurious nils
+// between scheduling ticks, so no caller needs to change. A caller that
+// starts the returned compaction must route its resulting sessionRecord
+// through s.commit(r, c) -- or, if it abandons c without compacting
+// anything, call s.sched.release(c) directly -- so the range becomes
+// available again.
 func (s *session) pickCompaction() *compaction {
-	icmp := s.cmp
-	ucmp := icmp.cmp
-
-	v := s.version_NB()
-
-	var level int
-	var t0 tFiles
-	if v.cScore >= 1 {
-		level = v.cLevel
-		cp := s.stCPtrs[level]
-		tt := v.tables[level]
-		for _, t := range tt {
-			if cp == nil || icmp.Compare(t.max, cp) > 0 {
-				t0 = append(t0, t)
-				break
-			}
-		}
-		if len(t0) == 0 {
-			t0 = append(t0, tt[0])
-		}
-	} else {
-		if p := atomic.LoadPointer(&v.cSeek); p != nil {
-			ts := (*tSet)(p)
-			level = ts.level
-			t0 = append(t0, ts.table)
-		} else {
-			return nil
-		}
-	}
-
-	c := &compaction{s: s, version: v, level: level}
-	if level == 0 {
-		min, max := t0.getRange(icmp)
-		t0 = nil
-		v.tables[0].getOverlaps(min.ukey(), max.ukey(), &t0, false, ucmp)
+	c := s.picker.Pick(s.version_NB())
+	if c == nil || !s.sched.acquire(c) {
+		return nil
 	}
-
-	c.tables[0] = t0
-	c.expand()
 	return c
 }
 
-// Create compaction from given level and range; need external synchronization.
+// Create compaction from given level and range; need external
+// synchronization. Delegated to s.picker for the same reason as
+// pickCompaction.
+//
+// Unlike pickCompaction, a nil here must keep meaning "nothing in
+// [min, max] left to compact", because DB.CompactRange loops on exactly
+// that to know the requested range is fully covered. So, unlike
+// pickCompaction, scheduler contention does not produce a nil: it blocks
+// until the conflicting compaction(s) release and the range can be
+// admitted, and only returns nil once the picker itself finds no more
+// overlapping tables. It uses acquireOrWait rather than a separate
+// acquire/wait pair so a release() landing between the admission check
+// and the wait is never missed.
 func (s *session) getCompactionRange(level int, min, max []byte) *compaction {
-	v := s.version_NB()
-
-	var t0 tFiles
-	v.tables[level].getOverlaps(min, max, &t0, level != 0, s.cmp.cmp)
-	if len(t0) == 0 {
-		return nil
+	for {
+		c := s.picker.PickRange(level, min, max)
+		if c == nil {
+			return nil
+		}
+		if s.sched.acquireOrWait(c) {
+			return c
+		}
 	}
-
-	c := &compaction{s: s, version: v, level: level}
-	c.tables[0] = t0
-	c.expand()
-	return c
 }
 
 // compaction represent a compaction state
@@ -385,13 +459,23 @@ func (c *compaction) newIterator() iterator.Iterator {
 
 		if level+i == 0 {
 			for _, t := range tt {
-				its = append(its, s.tops.newIterator(t, nil, ro))
+				it := s.tops.newIterator(t, nil, ro)
+				its = append(its, newThrottledIterator(it, s))
 			}
 		} else {
 			it := iterator.NewIndexedIterator(tt.newIndexIterator(s.tops, icmp, nil, ro), strict, true)
-			its = append(its, it)
+			its = append(its, newThrottledIterator(it, s))
 		}
 	}
 
 	return iterator.NewMergedIterator(its, icmp, true)
 }
+
+// newWriter wraps tw, the table writer used to build this compaction's
+// output sstable, so every appended key/value is metered and, if a
+// compaction write limiter is configured, rate limited -- the
+// output-side counterpart to newIterator's input throttling.
+// doCompactionWork must build its output writer through this.
+func (c *compaction) newWriter(tw tableWriter) tableWriter {
+	return newThrottledWriter(tw, c.s)
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package leveldb
+
+import (
+	"sync/atomic"
+
+	"github.com/philsong/goleveldb/leveldb/opt"
+)
+
+// CompactionPicker selects which tables to compact next. It is
+// responsible for both the background "pick whatever is most overdue"
+// path (Pick) and the explicit "compact this range" path (PickRange) used
+// by DB.CompactRange. Implementations must honor stCPtrs, seek-triggered
+// compactions (v.cSeek), and defer to compaction.expand() for the
+// grandparent-overlap constraints; CompactionPicker only decides which
+// level and which starting tables to hand to expand().
+type CompactionPicker interface {
+	// Pick returns the next compaction to run against v, or nil if
+	// nothing needs compacting right now.
+	Pick(v *version) *compaction
+
+	// PickRange returns a compaction covering [min, max] at level, or
+	// nil if no table at level overlaps the range.
+	PickRange(level int, min, max []byte) *compaction
+}
+
+// atomicLoadCSeek loads v.cSeek, the table that most recently accrued
+// too many seeks, if any.
+func atomicLoadCSeek(v *version) *tSet {
+	if p := atomic.LoadPointer(&v.cSeek); p != nil {
+		return (*tSet)(p)
+	}
+	return nil
+}
+
+// newCompactionPicker builds the CompactionPicker selected by
+// s.o.GetCompactionStrategy(), defaulting to the leveled picker.
+func newCompactionPicker(s *session) CompactionPicker {
+	switch s.o.GetCompactionStrategy() {
+	case opt.SizeTieredCompaction:
+		return newSizeTieredCompactionPicker(s)
+	default:
+		return &leveledCompactionPicker{s: s}
+	}
+}
+
+// leveledCompactionPicker is the original goleveldb policy: compact the
+// level with the highest cScore, or the table that most recently
+// triggered too many seeks.
+type leveledCompactionPicker struct {
+	s *session
+}
+
+func (p *leveledCompactionPicker) Pick(v *version) *compaction {
+	s := p.s
+	icmp := s.cmp
+	ucmp := icmp.cmp
+
+	var level int
+	var t0 tFiles
+	if v.cScore >= 1 {
+		level = v.cLevel
+		unlock := s.sched.lockCompactPointer(level)
+		cp := s.stCPtrs[level]
+		tt := v.tables[level]
+		for _, t := range tt {
+			if cp == nil || icmp.Compare(t.max, cp) > 0 {
+				t0 = append(t0, t)
+				break
+			}
+		}
+		if len(t0) == 0 {
+			t0 = append(t0, tt[0])
+		}
+		unlock()
+	} else {
+		if ts := atomicLoadCSeek(v); ts != nil {
+			level = ts.level
+			t0 = append(t0, ts.table)
+		} else {
+			return nil
+		}
+	}
+
+	c := &compaction{s: s, version: v, level: level}
+	if level == 0 {
+		min, max := t0.getRange(icmp)
+		t0 = nil
+		v.tables[0].getOverlaps(min.ukey(), max.ukey(), &t0, false, ucmp)
+	}
+
+	c.tables[0] = t0
+	c.expand()
+	return c
+}
+
+func (p *leveledCompactionPicker) PickRange(level int, min, max []byte) *compaction {
+	s := p.s
+	v := s.version_NB()
+
+	var t0 tFiles
+	v.tables[level].getOverlaps(min, max, &t0, level != 0, s.cmp.cmp)
+	if len(t0) == 0 {
+		return nil
+	}
+
+	c := &compaction{s: s, version: v, level: level}
+	c.tables[0] = t0
+	c.expand()
+	return c
+}
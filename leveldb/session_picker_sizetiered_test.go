@@ -0,0 +1,43 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package leveldb
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/philsong/goleveldb/leveldb/comparer"
+	"github.com/philsong/goleveldb/leveldb/opt"
+)
+
+var _ = Describe("sizeTieredCompactionPicker", func() {
+	It("pulls in an overlapping L0 file left out of the size-ratio run", func() {
+		s := &session{
+			cmp: &iComparer{cmp: comparer.DefaultComparer},
+			o:   &opt.Options{MinMergeTables: 2},
+		}
+		s.sched = newCompactionScheduler(s)
+		p := newSizeTieredCompactionPicker(s)
+
+		// Two similarly-sized tables form the size-ratio run picked
+		// by pickRun, but a third, much larger L0 table overlaps
+		// their combined range and must still be swept in -- L0
+		// files aren't disjoint, so leaving it behind would
+		// desynchronize read order between L0 and L1 afterwards.
+		inRun1 := &tFile{min: ik("a"), max: ik("f"), size: 100}
+		inRun2 := &tFile{min: ik("g"), max: ik("m"), size: 100}
+		overlapping := &tFile{min: ik("c"), max: ik("z"), size: 10000}
+
+		v := &version{s: s}
+		v.tables[0] = tFiles{inRun1, inRun2, overlapping}
+
+		c := p.Pick(v)
+		Expect(c).NotTo(BeNil())
+		Expect(c.level).To(Equal(0))
+		Expect(c.tables[0]).To(ContainElement(overlapping))
+	})
+})
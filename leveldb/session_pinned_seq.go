@@ -0,0 +1,65 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package leveldb
+
+import "sync"
+
+// pinnedSeqs tracks every sequence number that something outside of
+// doCompactionWork still needs to be able to read at. Only open
+// Transactions register here; snapshots taken via DB.GetSnapshot do not.
+// A sequence can appear more than once (two pinners at the same seq), so
+// this is a multiset.
+type pinnedSeqs struct {
+	mu   sync.Mutex
+	refs map[uint64]int
+}
+
+func newPinnedSeqs() *pinnedSeqs {
+	return &pinnedSeqs{refs: make(map[uint64]int)}
+}
+
+// pinSeq registers seq as still-needed.
+func (s *session) pinSeq(seq uint64) {
+	p := s.pinnedSeqs
+	p.mu.Lock()
+	p.refs[seq]++
+	p.mu.Unlock()
+}
+
+// unpinSeq reverses a prior pinSeq.
+func (s *session) unpinSeq(seq uint64) {
+	p := s.pinnedSeqs
+	p.mu.Lock()
+	if p.refs[seq] <= 1 {
+		delete(p.refs, seq)
+	} else {
+		p.refs[seq]--
+	}
+	p.mu.Unlock()
+}
+
+// minPinnedSeq returns the lowest currently-pinned sequence number and
+// true, or (0, false) if nothing is pinned. This is meant as a floor for
+// doCompactionWork to treat the same way it already does for the set of
+// open DB snapshots: an entry at or above this sequence is still
+// reachable by some open Transaction and must survive the compaction even
+// if a newer version of the same user key already shadows it. That
+// consultation is not wired up yet, so until it is, a long-lived
+// Transaction's view can still be corrupted by a concurrent compaction.
+func (s *session) minPinnedSeq() (uint64, bool) {
+	p := s.pinnedSeqs
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	min, ok := uint64(0), false
+	for seq := range p.refs {
+		if !ok || seq < min {
+			min, ok = seq, true
+		}
+	}
+	return min, ok
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package leveldb
+
+import (
+	"io"
+	"os"
+
+	"github.com/philsong/goleveldb/leveldb/journal"
+)
+
+// SessionRecordReplay receives the decoded contents of a sessionRecord
+// one field/record at a time, without the caller needing to depend on
+// sessionRecord or any other internal type. It mirrors the way a batch
+// replayer consumes a write-batch, and is the intended building block for
+// repair, migration and offline-analysis tools that want to walk a
+// MANIFEST (dumping level layouts, salvaging deleted-file lists,
+// rewriting comparer names, ...) from outside the leveldb package.
+//
+// key, min and max are always plain user keys: Replay strips the
+// internal-key trailer (sequence number and value type) that
+// sessionRecord stores them with before calling out, so implementations
+// never need to know iKey's encoding either.
+type SessionRecordReplay interface {
+	SetComparer(name string)
+	SetJournalNum(num uint64)
+	SetNextFileNum(num uint64)
+	SetSeq(num uint64)
+	SetCompactPointer(level int, key []byte)
+	AddTable(level int, num, size uint64, min, max []byte)
+	DeleteTable(level int, num uint64)
+}
+
+// Replay invokes the matching SessionRecordReplay method for every field
+// and record present on rec, in the order sessionRecord stores them.
+func (rec *sessionRecord) Replay(r SessionRecordReplay) {
+	if rec.has(recComparer) {
+		r.SetComparer(rec.comparer)
+	}
+	if rec.has(recJournalNum) {
+		r.SetJournalNum(rec.journalNum)
+	}
+	if rec.has(recNextNum) {
+		r.SetNextFileNum(rec.nextNum)
+	}
+	if rec.has(recSeq) {
+		r.SetSeq(rec.seq)
+	}
+	for _, cp := range rec.compactionPointers {
+		r.SetCompactPointer(cp.level, iKey(cp.key).ukey())
+	}
+	for _, at := range rec.addedTables {
+		r.AddTable(at.level, at.num, at.size, at.imin.ukey(), at.imax.ukey())
+	}
+	for _, dt := range rec.deletedTables {
+		r.DeleteTable(dt.level, dt.num)
+	}
+}
+
+// replayDropper logs journal corruption encountered while replaying a
+// MANIFEST outside of the normal recover path, where there's no
+// storage.File to attribute the error to.
+type replayDropper struct {
+	s    *session
+	path string
+}
+
+func (d replayDropper) Drop(err error) {
+	d.s.logf("manifest replay %s: %v (skipped)", d.path, err)
+}
+
+// ReplayManifest reads the MANIFEST journal at path and invokes r for
+// every record decoded from it, in order. It doesn't touch s's live
+// state (stCPtrs, stVersion, ...), so it's safe to call against a
+// MANIFEST belonging to a closed, or even a foreign, database -- s is
+// only used for logging skipped journal chunks.
+func (s *session) ReplayManifest(path string, r SessionRecordReplay) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	jr := journal.NewReader(f, replayDropper{s, path}, false, true)
+	rec := &sessionRecord{}
+	for {
+		reader, err := jr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if err := rec.decode(reader); err != nil {
+			return err
+		}
+		rec.Replay(r)
+		rec.resetCompactionPointers()
+		rec.resetAddedTables()
+		rec.resetDeletedTables()
+	}
+}
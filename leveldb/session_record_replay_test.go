@@ -0,0 +1,88 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package leveldb
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// recordingReplay implements SessionRecordReplay and just remembers every
+// call it received, so a test can assert on the replayed sequence without
+// depending on sessionRecord's internal layout.
+type recordingReplay struct {
+	comparer      string
+	journalNum    uint64
+	nextFileNum   uint64
+	seq           uint64
+	cptrs         []int
+	cptrKeys      [][]byte
+	addedLevels   []int
+	addedMin      [][]byte
+	addedMax      [][]byte
+	deletedLevels []int
+}
+
+func (r *recordingReplay) SetComparer(name string)   { r.comparer = name }
+func (r *recordingReplay) SetJournalNum(num uint64)  { r.journalNum = num }
+func (r *recordingReplay) SetNextFileNum(num uint64) { r.nextFileNum = num }
+func (r *recordingReplay) SetSeq(num uint64)         { r.seq = num }
+func (r *recordingReplay) SetCompactPointer(level int, key []byte) {
+	r.cptrs = append(r.cptrs, level)
+	r.cptrKeys = append(r.cptrKeys, key)
+}
+func (r *recordingReplay) AddTable(level int, num, size uint64, min, max []byte) {
+	r.addedLevels = append(r.addedLevels, level)
+	r.addedMin = append(r.addedMin, min)
+	r.addedMax = append(r.addedMax, max)
+}
+func (r *recordingReplay) DeleteTable(level int, num uint64) {
+	r.deletedLevels = append(r.deletedLevels, level)
+}
+
+var _ = Describe("sessionRecord.Replay", func() {
+	It("invokes the replayer for every field present on the record, with plain user keys", func() {
+		rec := &sessionRecord{}
+		rec.setComparer("test.Comparer")
+		rec.setJournalNum(7)
+		rec.setNextNum(42)
+		rec.setSeqNum(100)
+		rec.addCompactPointer(1, ik("m"))
+		rec.addTable(0, 1, 1024, ik("a"), ik("m"))
+		rec.addTable(1, 2, 2048, ik("n"), ik("z"))
+		rec.delTable(2, 3)
+
+		r := &recordingReplay{}
+		rec.Replay(r)
+
+		Expect(r.comparer).To(Equal("test.Comparer"))
+		Expect(r.journalNum).To(Equal(uint64(7)))
+		Expect(r.nextFileNum).To(Equal(uint64(42)))
+		Expect(r.seq).To(Equal(uint64(100)))
+		Expect(r.cptrs).To(Equal([]int{1}))
+		Expect(r.addedLevels).To(Equal([]int{0, 1}))
+		Expect(r.deletedLevels).To(Equal([]int{2}))
+
+		// Replay must hand over plain user keys, with the
+		// internal-key trailer (sequence number and value type)
+		// stripped -- not the raw iKey-encoded bytes ik() produced
+		// sessionRecord from.
+		Expect(r.cptrKeys).To(Equal([][]byte{[]byte("m")}))
+		Expect(r.addedMin).To(Equal([][]byte{[]byte("a"), []byte("n")}))
+		Expect(r.addedMax).To(Equal([][]byte{[]byte("m"), []byte("z")}))
+	})
+
+	It("skips fields the record never set", func() {
+		rec := &sessionRecord{}
+		r := &recordingReplay{}
+		rec.Replay(r)
+
+		Expect(r.comparer).To(BeEmpty())
+		Expect(r.cptrs).To(BeEmpty())
+		Expect(r.addedLevels).To(BeEmpty())
+	})
+})
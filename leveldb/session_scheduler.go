@@ -0,0 +1,182 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package leveldb
+
+import "sync"
+
+// defaultMaxConcurrentCompactions is used when
+// opt.Options.MaxConcurrentCompactions is left zero, preserving the
+// historical one-compaction-at-a-time behaviour.
+const defaultMaxConcurrentCompactions = 1
+
+// rangesOverlap reports whether [minA, maxA] and [minB, maxB] intersect.
+func rangesOverlap(icmp *iComparer, minA, maxA, minB, maxB iKey) bool {
+	return icmp.Compare(minA, maxB) <= 0 && icmp.Compare(minB, maxA) <= 0
+}
+
+// compactionScheduler arbitrates which compactions may run concurrently.
+// expand() grows a compaction picked at level L to also claim every
+// overlapping table at L+1 (reading and, on commit, deleting them), and
+// reads -- without deleting -- overlapping tables at L+2 to bound
+// grandparent overlap. So an in-flight compaction o actually owns tables
+// at both o.level and o.level+1, and a candidate c must stay clear of
+// that at any of the (up to three) levels c itself touches or reads:
+// c.level, c.level+1 and c.level+2. A candidate is only granted if its
+// range is disjoint from every in-flight compaction at every such shared
+// level; two admitted compactions can then never fight over the same
+// tables or violate expand()'s invariants.
+//
+// stCPtrs is still a single set of compact pointers shared by every
+// level; cpMu serializes advancing a given level's pointer so concurrent
+// pickers for different levels don't block each other while pickers for
+// the same level still see a consistent value.
+type compactionScheduler struct {
+	s *session
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	inflight []*compaction
+	cpMu     [kNumLevels]sync.Mutex
+}
+
+func newCompactionScheduler(s *session) *compactionScheduler {
+	cs := &compactionScheduler{s: s}
+	cs.cond = sync.NewCond(&cs.mu)
+	return cs
+}
+
+func (cs *compactionScheduler) maxConcurrent() int {
+	n := cs.s.o.GetMaxConcurrentCompactions()
+	if n <= 0 {
+		n = defaultMaxConcurrentCompactions
+	}
+	return n
+}
+
+// acquire admits c if it fits within MaxConcurrentCompactions and its
+// range doesn't overlap any in-flight compaction's owned levels (see the
+// type doc above). On success c is tracked as in-flight until release is
+// called.
+func (cs *compactionScheduler) acquire(c *compaction) bool {
+	if c == nil {
+		return false
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if !cs.canAdmitLocked(c) {
+		return false
+	}
+	cs.inflight = append(cs.inflight, c)
+	return true
+}
+
+// canAdmitLocked reports whether c fits within MaxConcurrentCompactions
+// and doesn't overlap any in-flight compaction's owned levels. The caller
+// must hold cs.mu.
+func (cs *compactionScheduler) canAdmitLocked(c *compaction) bool {
+	if len(cs.inflight) >= cs.maxConcurrent() {
+		return false
+	}
+
+	icmp := cs.s.cmp
+	// x.min/x.max only cover the level-L inputs; widen them by the
+	// level+1 inputs expand() claimed, which can reach further.
+	span := func(x *compaction) (min, max iKey) {
+		min, max = x.min, x.max
+		if len(x.tables[1]) > 0 {
+			tmin, tmax := x.tables[1].getRange(icmp)
+			if min == nil || icmp.Compare(tmin, min) < 0 {
+				min = tmin
+			}
+			if max == nil || icmp.Compare(tmax, max) > 0 {
+				max = tmax
+			}
+		}
+		return
+	}
+	cMin, cMax := span(c)
+	cLevels := [3]int{c.level, c.level + 1, c.level + 2}
+	for _, o := range cs.inflight {
+		oMin, oMax := span(o)
+		for _, ol := range [2]int{o.level, o.level + 1} {
+			for _, cl := range cLevels {
+				if ol != cl {
+					continue
+				}
+				if rangesOverlap(icmp, oMin, oMax, cMin, cMax) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// release stops tracking c as in-flight once its compaction has been
+// committed (or abandoned), and wakes up anyone blocked in wait.
+func (cs *compactionScheduler) release(c *compaction) {
+	cs.mu.Lock()
+	for i, o := range cs.inflight {
+		if o == c {
+			cs.inflight = append(cs.inflight[:i], cs.inflight[i+1:]...)
+			break
+		}
+	}
+	cs.mu.Unlock()
+	cs.cond.Broadcast()
+}
+
+// wait blocks until the in-flight set changes, i.e. until the next
+// release. A release that completes before wait takes cs.mu is not
+// observed; getCompactionRange therefore uses acquireOrWait instead.
+func (cs *compactionScheduler) wait() {
+	cs.mu.Lock()
+	cs.cond.Wait()
+	cs.mu.Unlock()
+}
+
+// acquireOrWait attempts to admit c the same way acquire does, but -- if
+// that fails -- blocks on cs.cond before returning, all under the same
+// lock acquisition. That closes the gap a separate acquire()-then-wait()
+// pair leaves open: a release() whose Broadcast lands between the failed
+// admission check and a later, freshly-acquired cs.mu.Lock() in wait()
+// would otherwise never be observed, stalling the caller past the point
+// the in-flight set it was waiting on actually cleared. Callers such as
+// getCompactionRange that need to keep retrying a range should loop on
+// this instead of acquire+wait.
+func (cs *compactionScheduler) acquireOrWait(c *compaction) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.canAdmitLocked(c) {
+		cs.inflight = append(cs.inflight, c)
+		return true
+	}
+	cs.cond.Wait()
+	return false
+}
+
+// lockCompactPointer serializes advances of stCPtrs[level] so concurrent
+// compactions picking at the same level don't race updating it, without
+// blocking pickers working on other levels. Both the picker's read (via
+// this method) and doCompactionWork's write of the advanced pointer (via
+// advanceCompactPointer) must go through cpMu[level] for that guarantee
+// to hold.
+func (cs *compactionScheduler) lockCompactPointer(level int) func() {
+	cs.cpMu[level].Lock()
+	return cs.cpMu[level].Unlock
+}
+
+// advanceCompactPointer sets stCPtrs[level] to key under the same
+// per-level lock lockCompactPointer uses to protect the picker's read, so
+// a compaction completing at level can't race a concurrent picker for
+// that same level advancing or reading the pointer.
+func (cs *compactionScheduler) advanceCompactPointer(level int, key iKey) {
+	unlock := cs.lockCompactPointer(level)
+	defer unlock()
+	cs.s.stCPtrs[level] = key
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package leveldb
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/philsong/goleveldb/leveldb/comparer"
+	"github.com/philsong/goleveldb/leveldb/opt"
+	"github.com/philsong/goleveldb/leveldb/testutil"
+)
+
+func newTestSchedulerSession() *session {
+	s := &session{
+		cmp: &iComparer{cmp: comparer.DefaultComparer},
+		// Two slots, so the tests below exercise range overlap rather
+		// than the default one-compaction cap.
+		o: &opt.Options{MaxConcurrentCompactions: 2},
+	}
+	s.sched = newCompactionScheduler(s)
+	return s
+}
+
+// newTestCommitSession is a real, storage-backed session -- unlike
+// newTestSchedulerSession's bare struct literal -- so s.commit can
+// actually write a manifest, for tests that exercise release through it.
+func newTestCommitSession() *session {
+	s, err := newSession(testutil.NewStorage(), nil)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(s.create()).NotTo(HaveOccurred())
+	return s
+}
+
+func ik(ukey string) iKey {
+	return newIkey([]byte(ukey), 0, ktVal)
+}
+
+var _ = Describe("compactionScheduler", func() {
+	It("rejects a candidate overlapping an in-flight compaction at the same level", func() {
+		s := newTestSchedulerSession()
+		o := &compaction{level: 1, min: ik("a"), max: ik("m")}
+		Expect(s.sched.acquire(o)).To(BeTrue())
+
+		c := &compaction{level: 1, min: ik("g"), max: ik("z")}
+		Expect(s.sched.acquire(c)).To(BeFalse())
+	})
+
+	It("rejects a candidate whose own level overlaps an in-flight compaction's level+1 input", func() {
+		s := newTestSchedulerSession()
+		// o runs at level 2 and, via expand(), also owns overlapping
+		// level-3 tables.
+		o := &compaction{level: 2, min: ik("a"), max: ik("m")}
+		Expect(s.sched.acquire(o)).To(BeTrue())
+
+		// c is picked at level 3 -- one level below o's own level,
+		// but within the span o's expand() already claimed -- and
+		// overlaps o's range. Before this fix only o.level (2) was
+		// compared against c.level/c.level+1/c.level+2 (3/4/5), so
+		// this collision went undetected.
+		c := &compaction{level: 3, min: ik("g"), max: ik("z")}
+		Expect(s.sched.acquire(c)).To(BeFalse())
+	})
+
+	It("admits non-overlapping compactions at adjacent levels", func() {
+		s := newTestSchedulerSession()
+		o := &compaction{level: 2, min: ik("a"), max: ik("c")}
+		Expect(s.sched.acquire(o)).To(BeTrue())
+
+		c := &compaction{level: 3, min: ik("x"), max: ik("z")}
+		Expect(s.sched.acquire(c)).To(BeTrue())
+	})
+
+	It("wakes up a waiter once the conflicting compaction releases", func() {
+		s := newTestSchedulerSession()
+		o := &compaction{level: 1, min: ik("a"), max: ik("m")}
+		Expect(s.sched.acquire(o)).To(BeTrue())
+
+		done := make(chan bool, 1)
+		go func() {
+			s.sched.wait()
+			done <- true
+		}()
+
+		// wait only sees a release that happens after it starts
+		// waiting, so keep releasing (a no-op once o is gone) until the
+		// waiter wakes.
+		Eventually(func() bool {
+			s.sched.release(o)
+			select {
+			case v := <-done:
+				return v
+			default:
+				return false
+			}
+		}).Should(BeTrue())
+	})
+
+	It("releases a real compaction from the scheduler once its sessionRecord commits", func() {
+		s := newTestCommitSession()
+		defer s.close()
+
+		o := &compaction{s: s, level: 1, min: ik("a"), max: ik("m")}
+		Expect(s.sched.acquire(o)).To(BeTrue())
+
+		// MaxConcurrentCompactions defaults to 1, so a second
+		// compaction can't be admitted while o is still in flight.
+		c := &compaction{s: s, level: 1, min: ik("g"), max: ik("z")}
+		Expect(s.sched.acquire(c)).To(BeFalse())
+
+		// Committing o's (empty) sessionRecord through s.commit(r, o)
+		// -- the path doCompactionWork must use -- releases o, so the
+		// slot it held becomes available again.
+		Expect(s.commit(&sessionRecord{}, o)).NotTo(HaveOccurred())
+		Expect(s.sched.acquire(c)).To(BeTrue())
+	})
+})
@@ -0,0 +1,23 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package leveldb
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/philsong/goleveldb/leveldb/testutil"
+)
+
+func TestSession(t *testing.T) {
+	testutil.RunDefer()
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Session Suite")
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package leveldb
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/philsong/goleveldb/leveldb/iterator"
+)
+
+// propertyCompactionThrottle is the property name that session.GetProperty
+// resolves to compactionThrottleStats.
+const propertyCompactionThrottle = "leveldb.compaction-throttle"
+
+// GetProperty resolves the session-owned property names. DB.GetProperty
+// does not call it, so these names are answered only here.
+func (s *session) GetProperty(name string) (value string, ok bool) {
+	if name != propertyCompactionThrottle {
+		return "", false
+	}
+	return s.compactionThrottleStats(), true
+}
+
+// compactionThrottleStats renders the compaction I/O counters in the form
+// GetProperty above returns for propertyCompactionThrottle.
+func (s *session) compactionThrottleStats() string {
+	return fmt.Sprintf(
+		"bytesRead=%d bytesWritten=%d throttleWait=%s",
+		atomic.LoadUint64(&s.compBytesRead),
+		atomic.LoadUint64(&s.compBytesWritten),
+		time.Duration(atomic.LoadUint64(&s.compThrottleWait)),
+	)
+}
+
+// throttledIterator wraps a table iterator and charges every key/value it
+// returns against the session's compaction read budget.
+type throttledIterator struct {
+	iterator.Iterator
+	s *session
+}
+
+// newThrottledIterator returns it wrapped so each entry it yields is
+// metered and, if a compaction read limiter is configured, rate limited.
+func newThrottledIterator(it iterator.Iterator, s *session) iterator.Iterator {
+	return &throttledIterator{Iterator: it, s: s}
+}
+
+func (it *throttledIterator) Next() bool {
+	ok := it.Iterator.Next()
+	if ok {
+		it.s.throttleRead(len(it.Iterator.Key()) + len(it.Iterator.Value()))
+	}
+	return ok
+}
+
+// chargeWrite charges len(key)+len(value) bytes of compaction output against the shared
+// write budget, blocking if a compaction write limiter is configured.
+// throttledWriter.append is the only caller; it exists separately so
+// tests can charge writes directly without needing a tableWriter.
+func (s *session) chargeWrite(key, value []byte) {
+	s.throttleWrite(len(key) + len(value))
+}
+
+// throttledWriter wraps the table writer used by compaction output,
+// charging every append against the session's compaction write budget via
+// chargeWrite.
+type throttledWriter struct {
+	tw tableWriter
+	s  *session
+}
+
+// newThrottledWriter returns tw wrapped so bytes appended to the output
+// sstable are metered and, if a compaction write limiter is configured,
+// rate limited. The table writer doCompactionWork builds its output
+// sstables with must be wrapped through this, the same way
+// newThrottledIterator meters the read side.
+func newThrottledWriter(tw tableWriter, s *session) tableWriter {
+	return &throttledWriter{tw: tw, s: s}
+}
+
+func (w *throttledWriter) append(key, value []byte) error {
+	w.s.chargeWrite(key, value)
+	return w.tw.append(key, value)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token-bucket throttle. Take blocks until n tokens are
+// available, refilling the bucket at rate tokens per second up to burst.
+// A RateLimiter with rate <= 0 never blocks.
+type RateLimiter struct {
+	mu sync.Mutex
+
+	rate  float64 // tokens added per second
+	burst float64 // bucket capacity
+
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a RateLimiter that allows up to rate bytes (or
+// any other unit) per second, bursting up to burst.
+func NewRateLimiter(rate, burst float64) *RateLimiter {
+	return &RateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Take blocks until n tokens are available and then consumes them,
+// returning how long it waited.
+func (r *RateLimiter) Take(n int) time.Duration {
+	if r == nil || r.rate <= 0 {
+		return 0
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	need := float64(n)
+	var wait time.Duration
+	if r.tokens < need {
+		wait = time.Duration((need - r.tokens) / r.rate * float64(time.Second))
+	}
+	r.tokens -= need
+	r.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	return wait
+}
+
+// SetLimit changes the bucket's rate and burst; existing buffered tokens
+// are kept, capped to the new burst.
+func (r *RateLimiter) SetLimit(rate, burst float64) {
+	r.mu.Lock()
+	r.rate = rate
+	r.burst = burst
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.mu.Unlock()
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2012, Suryandaru Triandana <syndtr@gmail.com>
+// All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package util
+
+import "testing"
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	var r *RateLimiter
+	if wait := r.Take(1 << 20); wait != 0 {
+		t.Fatalf("nil limiter should never wait, got %s", wait)
+	}
+
+	r = NewRateLimiter(0, 0)
+	if wait := r.Take(1 << 20); wait != 0 {
+		t.Fatalf("rate<=0 limiter should never wait, got %s", wait)
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	r := NewRateLimiter(100, 100)
+	if wait := r.Take(100); wait != 0 {
+		t.Fatalf("taking exactly the burst should not wait, got %s", wait)
+	}
+}
+
+func TestRateLimiterThrottles(t *testing.T) {
+	r := NewRateLimiter(1000, 10)
+	r.Take(10) // drain the initial burst
+
+	wait := r.Take(5)
+	if wait <= 0 {
+		t.Fatalf("taking past an empty bucket should wait, got %s", wait)
+	}
+}